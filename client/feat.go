@@ -0,0 +1,61 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"sort"
+
+	"github.com/yunify/qsftpd/context"
+)
+
+// featLines accumulates the capability lines advertised by the FEAT
+// command (RFC 2389), keyed by feature name so a feature registered more
+// than once replaces its line instead of duplicating it.
+var featLines = map[string]string{}
+
+// registerFeature adds or replaces a line advertised by FEAT.
+func registerFeature(name, line string) {
+	featLines[name] = line
+}
+
+func init() {
+	commandsMap["FEAT"] = &CommandDescription{Open: true, Fn: (*Handler).handleFEAT}
+}
+
+// handleFEAT implements the FEAT command, listing every capability
+// registered by the features that support it.
+func (c *Handler) handleFEAT() error {
+	names := make([]string, 0, len(featLines))
+	for name := range featLines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.sendFeatLine("211-Features:")
+	for _, name := range names {
+		c.sendFeatLine(" " + featLines[name])
+	}
+	c.sendFeatLine("211 End")
+	return nil
+}
+
+// sendFeatLine writes one line of a FEAT response and raises EventReply for
+// it, since these lines bypass the code/message shape of WriteMessage.
+func (c *Handler) sendFeatLine(line string) {
+	c.writeLine(line)
+	context.Emit(context.Event{Kind: context.EventReply, SessionID: c.id, Command: c.command, Message: line})
+}
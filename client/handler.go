@@ -18,12 +18,15 @@ package client
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yunify/qsftpd/context"
@@ -48,6 +51,24 @@ type Handler struct {
 	transferTLS   bool             // Use TLS for transfer connection
 	driver        Driver           // Client handling driver
 	driverFactory func() Driver    // Factory to create driver
+	tlsConfig     *tls.Config      // TLS configuration, nil disables FTPS
+	requireTLS    bool             // Refuse USER/PASS until the control connection is secured
+	secure        bool             // True once AUTH TLS/SSL has upgraded the control connection
+	timeouts      TimeoutsConfig   // Idle, login, control and transfer deadlines
+	transferMode  TransferMode     // Stream or deflate (MODE Z) transfer mode
+
+	compressionLevel    int  // Deflate compression level used by MODE Z
+	compressionLevelSet bool // True once OPTS MODE Z LEVEL=<n> has been issued
+
+	hashAlgo HashAlgo // Algorithm used by HASH, empty defaults to SHA-256
+
+	transferStartedAt time.Time     // When the current data connection was opened, for EventTransferEnd
+	dataConn          net.Conn      // The (possibly TLS/MODE Z wrapped) conn returned by the last TransferOpen
+	transferCounter   *countingConn // Tracks bytes moved on dataConn, for EventTransferEnd
+
+	writeMu sync.Mutex // Serializes control connection writes, e.g. against a concurrent Shutdown
+
+	limiterReleased bool // Guards against releasing the same ConnLimiter slot twice
 }
 
 // Path provides the current working directory of the client.
@@ -60,29 +81,64 @@ func (c *Handler) SetPath(path string) {
 	c.path = path
 }
 
+// EnableTLS attaches a TLS configuration to the handler, turning on support
+// for explicit FTPS (AUTH TLS / AUTH SSL) and PROT P data channel encryption.
+// When requireTLS is true, USER/PASS are refused until the control
+// connection has been upgraded.
+func (c *Handler) EnableTLS(config *tls.Config, requireTLS bool) {
+	c.tlsConfig = config
+	c.requireTLS = requireTLS
+}
+
+// Login marks the session as authenticated for user with driver, raising
+// EventLogin for registered hooks. Nothing in this package calls it: the
+// USER/PASS command handlers do not, so EventLogin is raised only where a
+// caller invokes Login or LoginFailed.
+func (c *Handler) Login(user string, driver Driver) {
+	c.user = user
+	c.driver = driver
+	context.Emit(context.Event{Kind: context.EventLogin, SessionID: c.id, User: user})
+}
+
+// LoginFailed raises EventLogin with Err set, without authenticating the
+// session. Like Login, it is not called by the USER/PASS command handlers.
+func (c *Handler) LoginFailed(user string, err error) {
+	context.Emit(context.Event{Kind: context.EventLogin, SessionID: c.id, User: user, Err: err})
+}
+
 // HandleCommands reads the stream of commands.
 func (c *Handler) HandleCommands() {
 	defer c.end()
 
 	for {
 		if c.reader == nil {
-			context.Logger.Debugf("Clean disconnect: ftp.disconnect, ID: %s, Clean: %t", c.id, true)
+			context.Emit(context.Event{Kind: context.EventDisconnect, SessionID: c.id, Message: "Clean disconnect"})
 			return
 		}
 
+		// A zero time clears a deadline left over from an earlier read, e.g.
+		// a LoginTimeout that no longer applies once the session is logged in.
+		var readDeadline time.Time
+		if deadline := c.readDeadline(); deadline > 0 {
+			readDeadline = time.Now().Add(deadline)
+		}
+		c.conn.SetReadDeadline(readDeadline)
+
 		line, err := c.reader.ReadString('\n')
 
 		if err != nil {
-			if err == io.EOF {
-				context.Logger.Debugf("TCP disconnect: ftp.disconnect, ID: %s, Clean: %t", c.id, false)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				context.Emit(context.Event{Kind: context.EventDisconnect, SessionID: c.id, Message: "Idle timeout", Err: err})
+				c.WriteMessage(421, "Idle timeout, closing connection")
+				c.disconnect()
+			} else if err == io.EOF {
+				context.Emit(context.Event{Kind: context.EventDisconnect, SessionID: c.id, Message: "TCP disconnect", Err: err})
 			} else {
-				context.Logger.Errorf("Read error: ftp.read_error, ID: %s, Error: %v", c.id, err)
+				context.Emit(context.Event{Kind: context.EventDisconnect, SessionID: c.id, Message: "Read error", Err: err})
 			}
 			return
 		}
 
-		context.Logger.Debugf("FTP RECV: ftp.cmd_recv, ID: %s, Line: %v", c.id, line)
-
 		c.handleCommand(line)
 	}
 }
@@ -95,22 +151,56 @@ func (c *Handler) TransferOpen() (net.Conn, error) {
 	}
 	c.WriteMessage(150, "Using transfer connection")
 	conn, err := c.transfer.Open()
-	if err == nil {
-		context.Logger.Debugf("FTP Transfer connection opened: ftp.transfer_open, ID: %s, RemoteAddr: %s, LocalAddr: %s", c.id, conn.RemoteAddr().String(), conn.LocalAddr().String())
-	} else {
-		context.Logger.Errorf("FTP Transfer connection open failed: %v: ", err)
+	if err != nil {
+		context.Emit(context.Event{Kind: context.EventTransferStart, SessionID: c.id, Err: err})
+		return nil, err
+	}
+
+	if c.transferTLS {
+		if c.tlsConfig == nil {
+			conn.Close()
+			return nil, errors.New("TLS is not configured")
+		}
+		conn = tls.Server(conn, c.tlsConfig)
+	}
+
+	if c.timeouts.TransferTimeout > 0 {
+		deadline := time.Now().Add(c.timeouts.TransferTimeout)
+		conn.SetDeadline(deadline)
 	}
 
-	return conn, err
+	conn = c.wrapModeZ(conn)
+
+	counter := &countingConn{Conn: conn}
+	c.transferCounter = counter
+	c.dataConn = counter
+	c.transferStartedAt = time.Now()
+	context.Emit(context.Event{Kind: context.EventTransferStart, SessionID: c.id, RemoteAddr: conn.RemoteAddr()})
+	return counter, nil
 }
 
-// TransferClose closes transfer with handler
+// TransferClose closes transfer with handler. It always closes the data
+// connection returned by TransferOpen itself: commands like RETR/LIST must
+// not be relied on to do it, since a MODE Z transfer only flushes its
+// flate stream once that connection is closed.
 func (c *Handler) TransferClose() {
 	if c.transfer != nil {
 		c.WriteMessage(226, "Closing transfer connection")
+		if c.dataConn != nil {
+			c.dataConn.Close()
+			c.dataConn = nil
+		}
 		c.transfer.Close()
 		c.transfer = nil
-		context.Logger.Debugf("FTP Transfer connection closed: ftp.transfer_close. ID: %s", c.id)
+
+		var bytesIn, bytesOut int64
+		if c.transferCounter != nil {
+			bytesIn = atomic.LoadInt64(&c.transferCounter.bytesRead)
+			bytesOut = atomic.LoadInt64(&c.transferCounter.bytesWritten)
+			c.transferCounter = nil
+		}
+
+		context.Emit(context.Event{Kind: context.EventTransferEnd, SessionID: c.id, BytesIn: bytesIn, BytesOut: bytesOut, Duration: time.Since(c.transferStartedAt)})
 	}
 }
 
@@ -120,6 +210,8 @@ func (c *Handler) handleCommand(line string) {
 	c.command = strings.ToUpper(command)
 	c.param = param
 
+	context.Emit(context.Event{Kind: context.EventCommand, SessionID: c.id, User: c.user, Command: c.command, Param: c.param})
+
 	cmdDesc, ok := commandsMap[c.command]
 	if !ok {
 		c.WriteMessage(500, "Unknown command")
@@ -136,6 +228,11 @@ func (c *Handler) handleCommand(line string) {
 		return
 	}
 
+	if c.requireTLS && !c.secure && (c.command == "USER" || c.command == "PASS") {
+		c.WriteMessage(530, "TLS is required before login, use AUTH TLS")
+		return
+	}
+
 	// Let's prepare to recover in case there's a command error.
 	defer func() {
 		if r := recover(); r != nil {
@@ -149,30 +246,59 @@ func (c *Handler) handleCommand(line string) {
 // WriteMessage writes server response
 func (c *Handler) WriteMessage(code int, message string) {
 	c.writeLine(fmt.Sprintf("%d %s", code, message))
+	context.Emit(context.Event{Kind: context.EventReply, SessionID: c.id, Command: c.command, Code: code, Message: message})
 }
 
 func (c *Handler) end() {
+	unregisterActive(c)
+	c.releaseLimiter()
 	if c.transfer != nil {
 		c.transfer.Close()
 	}
 }
 
 func (c *Handler) disconnect() {
+	unregisterActive(c)
+	c.releaseLimiter()
 	if c.transfer != nil {
 		c.transfer.Close()
 	}
 	c.conn.Close()
 }
 
+// releaseLimiter frees this connection's ConnLimiter slot, acquired in
+// NewHandler. It is safe to call more than once: end() and disconnect()
+// can both run for the same session.
+func (c *Handler) releaseLimiter() {
+	if limiter == nil || c.limiterReleased {
+		return
+	}
+	c.limiterReleased = true
+	limiter.Release(c.conn.RemoteAddr())
+}
+
 func (c *Handler) writeLine(line string) {
-	context.Logger.Debugf("FTP SEND: ftp.cmd_send, ID: %s, Line: %s", c.id, line)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.timeouts.ControlWriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeouts.ControlWriteTimeout))
+	}
 	c.writer.Write([]byte(line))
 	c.writer.Write([]byte("\r\n"))
 	c.writer.Flush()
 }
 
-// NewHandler initializes a client handler when someone connects.
+// NewHandler initializes a client handler when someone connects. If a
+// ConnLimiter has been installed via SetConnLimiter and MaxConnections or
+// MaxConnectionsPerIP would be exceeded, it replies "421 Too many
+// connections", closes connection and returns nil.
 func NewHandler(id string, connection net.Conn, driverFactory func() Driver) *Handler {
+	if limiter != nil && !limiter.Acquire(connection.RemoteAddr()) {
+		connection.Write([]byte("421 Too many connections\r\n"))
+		connection.Close()
+		return nil
+	}
 
 	p := &Handler{
 		id:            id,
@@ -184,6 +310,9 @@ func NewHandler(id string, connection net.Conn, driverFactory func() Driver) *Ha
 		driverFactory: driverFactory,
 	}
 
+	registerActive(p)
+	context.Emit(context.Event{Kind: context.EventConnect, SessionID: id, RemoteAddr: connection.RemoteAddr()})
+
 	// Just respecting the existing logic here, this could be probably be dropped at some point.
 	return p
 }
@@ -0,0 +1,154 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HashAlgo identifies one of the checksum algorithms exposed by HASH and
+// its legacy XCRC/XMD5/XSHA1/XSHA256 aliases.
+type HashAlgo string
+
+// Supported hash algorithms, as advertised in FEAT's "HASH" line.
+const (
+	HashAlgoCRC32  HashAlgo = "CRC32"
+	HashAlgoMD5    HashAlgo = "MD5"
+	HashAlgoSHA1   HashAlgo = "SHA-1"
+	HashAlgoSHA256 HashAlgo = "SHA-256"
+)
+
+func init() {
+	commandsMap["HASH"] = &CommandDescription{Fn: (*Handler).handleHASH}
+	commandsMap["XCRC"] = &CommandDescription{Fn: (*Handler).handleXCRC}
+	commandsMap["XMD5"] = &CommandDescription{Fn: (*Handler).handleXMD5}
+	commandsMap["XSHA1"] = &CommandDescription{Fn: (*Handler).handleXSHA1}
+	commandsMap["XSHA256"] = &CommandDescription{Fn: (*Handler).handleXSHA256}
+	optsHandlers["HASH"] = (*Handler).handleOPTSHash
+	registerFeature("HASH", "HASH SHA-1;SHA-256*;MD5;CRC32")
+}
+
+// selectedHashAlgo returns the algorithm HASH currently computes with,
+// defaulting to SHA-256 until the client picks another one via OPTS HASH.
+func (c *Handler) selectedHashAlgo() HashAlgo {
+	if c.hashAlgo == "" {
+		return HashAlgoSHA256
+	}
+	return c.hashAlgo
+}
+
+// handleOPTSHash implements "OPTS HASH <algo>", changing the algorithm used
+// by subsequent HASH commands on this control connection.
+func (c *Handler) handleOPTSHash(args string) error {
+	algo := HashAlgo(strings.ToUpper(strings.TrimSpace(args)))
+	switch algo {
+	case HashAlgoCRC32, HashAlgoMD5, HashAlgoSHA1, HashAlgoSHA256:
+		c.hashAlgo = algo
+		c.WriteMessage(200, "OPTS HASH command successful")
+		return nil
+	default:
+		c.WriteMessage(504, "Unsupported hash algorithm "+args)
+		return errors.New("unsupported hash algorithm " + args)
+	}
+}
+
+// handleHASH implements the HASH command: "HASH <path> [<start>-<end>]"
+// returns a checksum of path computed with the currently selected algorithm.
+func (c *Handler) handleHASH() error {
+	fields := strings.Fields(c.param)
+	if len(fields) == 0 {
+		c.WriteMessage(501, "Usage: HASH <path> [<start>-<end>]")
+		return errors.New("missing path")
+	}
+
+	path := fields[0]
+	start, end := int64(0), int64(-1)
+	if len(fields) > 1 {
+		var err error
+		start, end, err = parseHashRange(fields[1])
+		if err != nil {
+			c.WriteMessage(501, "Invalid range "+fields[1])
+			return err
+		}
+	}
+
+	algo := c.selectedHashAlgo()
+	hash, err := c.driver.ComputeHash(path, algo, start, end)
+	if err != nil {
+		c.WriteMessage(550, fmt.Sprintf("Could not compute hash: %v", err))
+		return err
+	}
+
+	c.WriteMessage(213, fmt.Sprintf("%s %s %s %s", algo, formatHashRange(start, end), hash, path))
+	return nil
+}
+
+// formatHashRange renders the "start-end" segment of a HASH reply. end is
+// -1 for a rangeless request, i.e. the whole file: there is no end offset
+// to report without knowing the file's size, so it is left open-ended
+// rather than printed as a bogus negative number.
+func formatHashRange(start, end int64) string {
+	if end < 0 {
+		return fmt.Sprintf("%d-", start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
+
+func (c *Handler) handleXCRC() error    { return c.handleLegacyHash(HashAlgoCRC32) }
+func (c *Handler) handleXMD5() error    { return c.handleLegacyHash(HashAlgoMD5) }
+func (c *Handler) handleXSHA1() error   { return c.handleLegacyHash(HashAlgoSHA1) }
+func (c *Handler) handleXSHA256() error { return c.handleLegacyHash(HashAlgoSHA256) }
+
+// handleLegacyHash implements the pre-HASH XCRC/XMD5/XSHA1/XSHA256 aliases,
+// each fixed to a single algorithm and replying with the bare checksum.
+func (c *Handler) handleLegacyHash(algo HashAlgo) error {
+	path := strings.TrimSpace(c.param)
+	if path == "" {
+		c.WriteMessage(501, "Usage: "+c.command+" <path>")
+		return errors.New("missing path")
+	}
+
+	hash, err := c.driver.ComputeHash(path, algo, 0, -1)
+	if err != nil {
+		c.WriteMessage(550, fmt.Sprintf("Could not compute hash: %v", err))
+		return err
+	}
+
+	c.WriteMessage(250, hash)
+	return nil
+}
+
+// parseHashRange parses a RFC 3659 style "start-end" byte range.
+func parseHashRange(raw string) (int64, int64, error) {
+	startStr, endStr, found := strings.Cut(raw, "-")
+	if !found {
+		return 0, 0, errors.New("malformed range " + raw)
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
@@ -0,0 +1,68 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import "testing"
+
+func TestParseHashRange(t *testing.T) {
+	cases := []struct {
+		raw        string
+		start, end int64
+		wantErr    bool
+	}{
+		{raw: "0-499", start: 0, end: 499},
+		{raw: "100-100", start: 100, end: 100},
+		{raw: "100", wantErr: true},
+		{raw: "a-b", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		start, end, err := parseHashRange(tc.raw)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseHashRange(%q): expected error, got none", tc.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHashRange(%q): unexpected error: %v", tc.raw, err)
+			continue
+		}
+		if start != tc.start || end != tc.end {
+			t.Errorf("parseHashRange(%q) = %d, %d; want %d, %d", tc.raw, start, end, tc.start, tc.end)
+		}
+	}
+}
+
+func TestFormatHashRange(t *testing.T) {
+	cases := []struct {
+		start, end int64
+		want       string
+	}{
+		{start: 0, end: -1, want: "0-"},
+		{start: 100, end: -1, want: "100-"},
+		{start: 0, end: 499, want: "0-499"},
+	}
+
+	for _, tc := range cases {
+		got := formatHashRange(tc.start, tc.end)
+		if got != tc.want {
+			t.Errorf("formatHashRange(%d, %d) = %q; want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
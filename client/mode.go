@@ -0,0 +1,163 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// TransferMode identifies the FTP MODE in use for data connections.
+type TransferMode byte
+
+const (
+	// TransferModeStream is the default FTP transfer mode (MODE S).
+	TransferModeStream TransferMode = iota
+	// TransferModeDeflate compresses data connections with compress/flate (MODE Z).
+	TransferModeDeflate
+)
+
+// uploadCommands lists the FTP verbs that send data from client to server,
+// i.e. ones whose data connection MODE Z must decompress on Read rather
+// than compress on Write. Anything not listed here is treated as a
+// download (RETR, LIST, NLST, MLSD, ...).
+var uploadCommands = map[string]bool{
+	"STOR": true,
+	"STOU": true,
+	"APPE": true,
+}
+
+func init() {
+	commandsMap["MODE"] = &CommandDescription{Fn: (*Handler).handleMODE}
+	optsHandlers["MODE"] = (*Handler).handleOPTSMode
+	registerFeature("MODE", "MODE Z")
+}
+
+// handleMODE implements the MODE command, switching subsequently opened
+// data connections between stream (S) and deflate (Z) transfer mode.
+func (c *Handler) handleMODE() error {
+	switch strings.ToUpper(c.param) {
+	case "S":
+		c.transferMode = TransferModeStream
+		c.WriteMessage(200, "Mode set to S")
+		return nil
+	case "Z":
+		c.transferMode = TransferModeDeflate
+		c.WriteMessage(200, "Mode set to Z")
+		return nil
+	default:
+		c.WriteMessage(504, "Unsupported transfer mode "+c.param)
+		return errors.New("unsupported transfer mode " + c.param)
+	}
+}
+
+// handleOPTSMode implements "OPTS MODE Z LEVEL=<n>", letting clients tune
+// the deflate compression level used once MODE Z is selected.
+func (c *Handler) handleOPTSMode(args string) error {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || strings.ToUpper(fields[0]) != "Z" {
+		c.WriteMessage(501, "Usage: OPTS MODE Z LEVEL=<n>")
+		return errors.New("malformed OPTS MODE command")
+	}
+
+	for _, field := range fields[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found || strings.ToUpper(key) != "LEVEL" {
+			continue
+		}
+		level, err := strconv.Atoi(value)
+		if err != nil || level < flate.HuffmanOnly || level > flate.BestCompression {
+			c.WriteMessage(501, "Invalid compression level "+value)
+			return errors.New("invalid compression level " + value)
+		}
+		c.compressionLevel = level
+		c.compressionLevelSet = true
+	}
+
+	c.WriteMessage(200, "OPTS MODE Z command successful")
+	return nil
+}
+
+// wrapModeZ wraps a freshly opened data connection with compress/flate when
+// MODE Z is active: writes are compressed for downloads (RETR, LIST, ...),
+// reads are decompressed for uploads (STOR, APPE).
+func (c *Handler) wrapModeZ(conn net.Conn) net.Conn {
+	if c.transferMode != TransferModeDeflate {
+		return conn
+	}
+
+	level := flate.DefaultCompression
+	if c.compressionLevelSet {
+		level = c.compressionLevel
+	}
+
+	return newModeZConn(conn, c.command, level)
+}
+
+// modeZConn adapts a net.Conn to MODE Z, compressing or decompressing data
+// as it flows through Read/Write while leaving addressing and deadlines to
+// the wrapped connection.
+type modeZConn struct {
+	net.Conn
+	fw *flate.Writer
+	fr io.ReadCloser
+}
+
+func newModeZConn(conn net.Conn, command string, level int) *modeZConn {
+	mz := &modeZConn{Conn: conn}
+
+	switch {
+	case uploadCommands[command]:
+		mz.fr = flate.NewReader(conn)
+	default:
+		fw, err := flate.NewWriter(conn, level)
+		if err != nil {
+			fw, _ = flate.NewWriter(conn, flate.DefaultCompression)
+		}
+		mz.fw = fw
+	}
+
+	return mz
+}
+
+func (mz *modeZConn) Read(p []byte) (int, error) {
+	if mz.fr != nil {
+		return mz.fr.Read(p)
+	}
+	return mz.Conn.Read(p)
+}
+
+func (mz *modeZConn) Write(p []byte) (int, error) {
+	if mz.fw != nil {
+		return mz.fw.Write(p)
+	}
+	return mz.Conn.Write(p)
+}
+
+func (mz *modeZConn) Close() error {
+	if mz.fw != nil {
+		mz.fw.Close()
+	}
+	if mz.fr != nil {
+		mz.fr.Close()
+	}
+	return mz.Conn.Close()
+}
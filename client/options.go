@@ -0,0 +1,45 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"errors"
+	"strings"
+)
+
+// optsHandlers dispatches "OPTS <FEATURE> <args>" to the handler registered
+// for that feature, keyed by the upper-cased feature name.
+var optsHandlers = map[string]func(*Handler, string) error{}
+
+func init() {
+	commandsMap["OPTS"] = &CommandDescription{Open: true, Fn: (*Handler).handleOPTS}
+}
+
+// handleOPTS implements the generic OPTS command by forwarding to whichever
+// feature registered itself in optsHandlers, e.g. "OPTS MODE Z LEVEL=6".
+func (c *Handler) handleOPTS() error {
+	feature, args, _ := strings.Cut(strings.TrimSpace(c.param), " ")
+	feature = strings.ToUpper(feature)
+
+	handler, ok := optsHandlers[feature]
+	if !ok {
+		c.WriteMessage(502, "OPTS "+feature+" not supported")
+		return errors.New("unsupported OPTS feature " + feature)
+	}
+
+	return handler(c, strings.TrimSpace(args))
+}
@@ -0,0 +1,54 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"bufio"
+	"io"
+	"testing"
+)
+
+func newTestHandler(param string) *Handler {
+	return &Handler{
+		param:  param,
+		writer: bufio.NewWriter(io.Discard),
+	}
+}
+
+func TestHandleOPTSDispatchesToRegisteredFeature(t *testing.T) {
+	var gotArgs string
+	optsHandlers["TESTFEATURE"] = func(c *Handler, args string) error {
+		gotArgs = args
+		return nil
+	}
+	defer delete(optsHandlers, "TESTFEATURE")
+
+	c := newTestHandler("testfeature  LEVEL=6")
+	if err := c.handleOPTS(); err != nil {
+		t.Fatalf("handleOPTS() returned error: %v", err)
+	}
+	if gotArgs != "LEVEL=6" {
+		t.Errorf("handleOPTS() passed args %q; want %q", gotArgs, "LEVEL=6")
+	}
+}
+
+func TestHandleOPTSUnknownFeature(t *testing.T) {
+	c := newTestHandler("NOSUCHFEATURE")
+	if err := c.handleOPTS(); err == nil {
+		t.Fatal("handleOPTS() with an unregistered feature should return an error")
+	}
+}
@@ -0,0 +1,183 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// SessionInfo is a point-in-time snapshot of one active session, returned by
+// ActiveSessions so operators can build admin/status endpoints.
+type SessionInfo struct {
+	ID          string
+	User        string
+	RemoteAddr  string
+	ConnectedAt time.Time
+	Command     string
+}
+
+var (
+	activeMu sync.Mutex
+	active   = map[string]*Handler{}
+)
+
+func registerActive(c *Handler) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	active[c.id] = c
+}
+
+func unregisterActive(c *Handler) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	delete(active, c.id)
+}
+
+// ActiveSessions returns a snapshot of every currently connected client.
+func ActiveSessions() []SessionInfo {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+
+	sessions := make([]SessionInfo, 0, len(active))
+	for _, c := range active {
+		sessions = append(sessions, SessionInfo{
+			ID:          c.id,
+			User:        c.user,
+			RemoteAddr:  c.conn.RemoteAddr().String(),
+			ConnectedAt: c.connectedAt,
+			Command:     c.command,
+		})
+	}
+	return sessions
+}
+
+// Shutdown notifies every active handler that the server is going away,
+// waits for their command loops to finish or for ctx to expire, and force
+// closes whatever is left. It is the client package's analogue of
+// net/http.Server.Shutdown; the listener itself must stop accepting new
+// connections before calling it.
+func Shutdown(ctx context.Context) error {
+	for _, c := range snapshotActive() {
+		c.WriteMessage(421, "Server shutting down")
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if len(snapshotActive()) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, c := range snapshotActive() {
+				c.disconnect()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func snapshotActive() []*Handler {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+
+	handlers := make([]*Handler, 0, len(active))
+	for _, c := range active {
+		handlers = append(handlers, c)
+	}
+	return handlers
+}
+
+// limiter is the ConnLimiter NewHandler enforces for every new connection,
+// installed via SetConnLimiter. A nil limiter disables limiting.
+var limiter *ConnLimiter
+
+// SetConnLimiter installs the limiter NewHandler checks before accepting a
+// connection. Pass nil to disable limiting.
+func SetConnLimiter(l *ConnLimiter) {
+	limiter = l
+}
+
+// ConnLimiter rejects new sockets once MaxConnections or
+// MaxConnectionsPerIP is reached. A zero bound disables that check.
+type ConnLimiter struct {
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+// NewConnLimiter builds a ConnLimiter with the given bounds.
+func NewConnLimiter(maxConnections, maxConnectionsPerIP int) *ConnLimiter {
+	return &ConnLimiter{
+		MaxConnections:      maxConnections,
+		MaxConnectionsPerIP: maxConnectionsPerIP,
+		perIP:               map[string]int{},
+	}
+}
+
+// Acquire reserves a connection slot for remoteAddr, returning false if
+// doing so would exceed MaxConnections or MaxConnectionsPerIP. Callers
+// should reply "421 Too many connections" and close the socket on false.
+// Every successful Acquire must be paired with a Release.
+func (l *ConnLimiter) Acquire(remoteAddr net.Addr) bool {
+	host := hostOf(remoteAddr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.MaxConnections > 0 && l.total >= l.MaxConnections {
+		return false
+	}
+	if l.MaxConnectionsPerIP > 0 && l.perIP[host] >= l.MaxConnectionsPerIP {
+		return false
+	}
+
+	l.total++
+	l.perIP[host]++
+	return true
+}
+
+// Release frees the slot reserved by a prior successful Acquire.
+func (l *ConnLimiter) Release(remoteAddr net.Addr) {
+	host := hostOf(remoteAddr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	l.perIP[host]--
+	if l.perIP[host] <= 0 {
+		delete(l.perIP, host)
+	}
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,75 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func addr(hostPort string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(hostPort)}
+}
+
+func TestConnLimiterMaxConnections(t *testing.T) {
+	l := NewConnLimiter(2, 0)
+
+	if !l.Acquire(addr("10.0.0.1")) {
+		t.Fatal("first Acquire should succeed")
+	}
+	if !l.Acquire(addr("10.0.0.2")) {
+		t.Fatal("second Acquire should succeed")
+	}
+	if l.Acquire(addr("10.0.0.3")) {
+		t.Fatal("third Acquire should fail once MaxConnections is reached")
+	}
+
+	l.Release(addr("10.0.0.1"))
+	if !l.Acquire(addr("10.0.0.3")) {
+		t.Fatal("Acquire should succeed again after a Release frees a slot")
+	}
+}
+
+func TestConnLimiterMaxConnectionsPerIP(t *testing.T) {
+	l := NewConnLimiter(0, 1)
+
+	if !l.Acquire(addr("10.0.0.1")) {
+		t.Fatal("first Acquire for an IP should succeed")
+	}
+	if l.Acquire(addr("10.0.0.1")) {
+		t.Fatal("second Acquire for the same IP should fail once MaxConnectionsPerIP is reached")
+	}
+	if !l.Acquire(addr("10.0.0.2")) {
+		t.Fatal("Acquire for a different IP should still succeed")
+	}
+
+	l.Release(addr("10.0.0.1"))
+	if !l.Acquire(addr("10.0.0.1")) {
+		t.Fatal("Acquire should succeed again after a Release frees that IP's slot")
+	}
+}
+
+func TestConnLimiterReleaseEvictsIP(t *testing.T) {
+	l := NewConnLimiter(0, 0)
+
+	l.Acquire(addr("10.0.0.1"))
+	l.Release(addr("10.0.0.1"))
+
+	if _, ok := l.perIP["10.0.0.1"]; ok {
+		t.Fatal("Release should remove the IP entry once its count drops to zero")
+	}
+}
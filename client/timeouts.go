@@ -0,0 +1,54 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import "time"
+
+// TimeoutsConfig groups every connection deadline the handler enforces.
+// A zero value for any field disables that particular deadline.
+type TimeoutsConfig struct {
+	IdleTimeout         time.Duration // Max time between two commands once logged in
+	LoginTimeout        time.Duration // Max time between two commands before login, usually shorter than IdleTimeout to mitigate slowloris-style attacks
+	ControlReadTimeout  time.Duration // Deadline applied to each read on the control connection
+	ControlWriteTimeout time.Duration // Deadline applied to each write on the control connection
+	TransferTimeout     time.Duration // Deadline applied to data connections returned by TransferOpen
+}
+
+// SetTimeouts attaches a TimeoutsConfig to the handler. It must be called
+// before HandleCommands starts reading, typically right after NewHandler.
+func (c *Handler) SetTimeouts(timeouts TimeoutsConfig) {
+	c.timeouts = timeouts
+}
+
+// readDeadline returns the deadline to apply to the next control read: the
+// shorter of the applicable idle deadline (LoginTimeout before
+// authentication, IdleTimeout afterwards) and ControlReadTimeout.
+func (c *Handler) readDeadline() time.Duration {
+	idle := c.timeouts.IdleTimeout
+	if c.driver == nil && c.timeouts.LoginTimeout > 0 {
+		idle = c.timeouts.LoginTimeout
+	}
+
+	switch {
+	case idle <= 0:
+		return c.timeouts.ControlReadTimeout
+	case c.timeouts.ControlReadTimeout > 0 && c.timeouts.ControlReadTimeout < idle:
+		return c.timeouts.ControlReadTimeout
+	default:
+		return idle
+	}
+}
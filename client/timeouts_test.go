@@ -0,0 +1,84 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// mockDriver is a stand-in Driver used only to exercise the c.driver == nil
+// check in readDeadline; it need not implement behavior beyond that.
+type mockDriver struct{ Driver }
+
+func TestReadDeadline(t *testing.T) {
+	cases := []struct {
+		name     string
+		timeouts TimeoutsConfig
+		loggedIn bool
+		want     time.Duration
+	}{
+		{
+			name:     "before login uses LoginTimeout over IdleTimeout",
+			timeouts: TimeoutsConfig{IdleTimeout: time.Minute, LoginTimeout: 10 * time.Second},
+			loggedIn: false,
+			want:     10 * time.Second,
+		},
+		{
+			name:     "after login uses IdleTimeout",
+			timeouts: TimeoutsConfig{IdleTimeout: time.Minute, LoginTimeout: 10 * time.Second},
+			loggedIn: true,
+			want:     time.Minute,
+		},
+		{
+			name:     "ControlReadTimeout wins when shorter than idle",
+			timeouts: TimeoutsConfig{IdleTimeout: time.Minute, ControlReadTimeout: 5 * time.Second},
+			loggedIn: true,
+			want:     5 * time.Second,
+		},
+		{
+			name:     "idle wins when shorter than ControlReadTimeout",
+			timeouts: TimeoutsConfig{IdleTimeout: 5 * time.Second, ControlReadTimeout: time.Minute},
+			loggedIn: true,
+			want:     5 * time.Second,
+		},
+		{
+			name:     "no idle deadline falls back to ControlReadTimeout",
+			timeouts: TimeoutsConfig{ControlReadTimeout: 30 * time.Second},
+			loggedIn: true,
+			want:     30 * time.Second,
+		},
+		{
+			name:     "nothing configured means no deadline",
+			timeouts: TimeoutsConfig{},
+			loggedIn: true,
+			want:     0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Handler{timeouts: tc.timeouts}
+			if tc.loggedIn {
+				c.driver = &mockDriver{}
+			}
+			if got := c.readDeadline(); got != tc.want {
+				t.Errorf("readDeadline() = %s; want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"github.com/yunify/qsftpd/context"
+)
+
+func init() {
+	commandsMap["AUTH"] = &CommandDescription{Open: true, Fn: (*Handler).handleAUTH}
+	commandsMap["PBSZ"] = &CommandDescription{Open: true, Fn: (*Handler).handlePBSZ}
+	commandsMap["PROT"] = &CommandDescription{Open: true, Fn: (*Handler).handlePROT}
+
+	registerFeature("AUTH", "AUTH TLS;AUTH SSL")
+	registerFeature("PBSZ", "PBSZ")
+	registerFeature("PROT", "PROT")
+}
+
+// handleAUTH implements RFC 4217 explicit FTPS negotiation: it upgrades the
+// control connection to TLS in response to "AUTH TLS" or "AUTH SSL".
+func (c *Handler) handleAUTH() error {
+	switch strings.ToUpper(c.param) {
+	case "TLS", "SSL":
+		if c.tlsConfig == nil {
+			c.WriteMessage(550, "TLS is not configured on this server")
+			return errors.New("TLS is not configured")
+		}
+
+		c.WriteMessage(234, "AUTH command ok, expecting TLS negotiation")
+
+		conn := tls.Server(c.conn, c.tlsConfig)
+		if err := conn.Handshake(); err != nil {
+			context.Logger.Errorf("TLS handshake failed: ftp.tls_handshake_error, ID: %s, Error: %v", c.id, err)
+			c.disconnect()
+			return err
+		}
+
+		c.conn = conn
+		c.reader = bufio.NewReader(conn)
+		c.writer = bufio.NewWriter(conn)
+		c.secure = true
+		return nil
+	default:
+		c.WriteMessage(504, "Unsupported auth type "+c.param)
+		return errors.New("unsupported auth type " + c.param)
+	}
+}
+
+// handlePBSZ implements the Protection Buffer Size command. qsftpd doesn't
+// chunk protected replies, so it always agrees on a buffer size of 0.
+func (c *Handler) handlePBSZ() error {
+	c.WriteMessage(200, "PBSZ=0 successful")
+	return nil
+}
+
+// handlePROT sets the protection level applied to data connections opened
+// by TransferOpen: "C" for clear text, "P" for private (TLS).
+func (c *Handler) handlePROT() error {
+	switch strings.ToUpper(c.param) {
+	case "C":
+		c.transferTLS = false
+		c.WriteMessage(200, "PROT command successful")
+		return nil
+	case "P":
+		if c.tlsConfig == nil {
+			c.WriteMessage(550, "TLS is not configured on this server")
+			return errors.New("TLS is not configured")
+		}
+		c.transferTLS = true
+		c.WriteMessage(200, "PROT command successful")
+		return nil
+	default:
+		c.WriteMessage(504, "Unsupported protection level "+c.param)
+		return errors.New("unsupported protection level " + c.param)
+	}
+}
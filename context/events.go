@@ -0,0 +1,131 @@
+// +-------------------------------------------------------------------------
+// | Copyright (C) 2017 Yunify, Inc.
+// +-------------------------------------------------------------------------
+// | Licensed under the Apache License, Version 2.0 (the "License");
+// | you may not use this work except in compliance with the License.
+// | You may obtain a copy of the License in the LICENSE file, or at:
+// |
+// | http://www.apache.org/licenses/LICENSE-2.0
+// |
+// | Unless required by applicable law or agreed to in writing, software
+// | distributed under the License is distributed on an "AS IS" BASIS,
+// | WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// | See the License for the specific language governing permissions and
+// | limitations under the License.
+// +-------------------------------------------------------------------------
+
+package context
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// EventKind identifies the kind of occurrence a hook is being notified of.
+type EventKind int
+
+const (
+	// EventConnect fires once a client's control connection is accepted.
+	EventConnect EventKind = iota
+	// EventCommand fires when a command line has been received and parsed.
+	EventCommand
+	// EventReply fires whenever a response is written back to the client.
+	EventReply
+	// EventLogin fires when the client package's Handler.Login or
+	// Handler.LoginFailed is called.
+	EventLogin
+	// EventTransferStart fires when a data connection has been opened.
+	EventTransferStart
+	// EventTransferEnd fires when a data connection has been closed.
+	EventTransferEnd
+	// EventDisconnect fires once the control connection is torn down.
+	EventDisconnect
+)
+
+// Event describes one occurrence on a client's session, passed to every
+// hook registered with RegisterHook.
+type Event struct {
+	Kind       EventKind
+	SessionID  string
+	User       string
+	Command    string
+	Param      string
+	Code       int
+	Message    string
+	RemoteAddr net.Addr
+	BytesIn    int64
+	BytesOut   int64
+	Duration   time.Duration
+	Err        error
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []func(Event)
+)
+
+// RegisterHook adds a function that is called for every Event raised by the
+// client package. It lets operators plug in Prometheus metrics, JSON audit
+// logs or SIEM shippers without touching the client package itself. Hooks
+// run synchronously, in registration order, on the goroutine that raises the
+// event: usually the connection's own, but the caller's for the reply sent
+// by client.Shutdown. They should not block. RegisterHook is safe to call while connections
+// are being served.
+func RegisterHook(hook func(Event)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// Emit raises e on every hook registered with RegisterHook. The client
+// package calls this for every connection, command, reply, transfer and
+// disconnect, and for each Handler.Login/LoginFailed call; it lives here rather than in client so operators can
+// subscribe without patching the client package.
+func Emit(e Event) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(e)
+	}
+}
+
+func init() {
+	RegisterHook(logEvent)
+}
+
+// logEvent is the default hook, preserving the historical log lines emitted
+// directly from the client package before the event bus existed.
+func logEvent(e Event) {
+	switch e.Kind {
+	case EventConnect:
+		Logger.Debugf("Client connected: ftp.connect, ID: %s, RemoteAddr: %v", e.SessionID, e.RemoteAddr)
+	case EventCommand:
+		Logger.Debugf("FTP RECV: ftp.cmd_recv, ID: %s, Line: %v", e.SessionID, e.Command+" "+e.Param)
+	case EventReply:
+		Logger.Debugf("FTP SEND: ftp.cmd_send, ID: %s, Line: %d %s", e.SessionID, e.Code, e.Message)
+	case EventLogin:
+		if e.Err != nil {
+			Logger.Errorf("Login failed: ftp.login_error, ID: %s, User: %s, Error: %v", e.SessionID, e.User, e.Err)
+		} else {
+			Logger.Debugf("Login: ftp.login, ID: %s, User: %s", e.SessionID, e.User)
+		}
+	case EventTransferStart:
+		if e.Err != nil {
+			Logger.Errorf("FTP Transfer connection open failed: %v: ", e.Err)
+		} else {
+			Logger.Debugf("FTP Transfer connection opened: ftp.transfer_open, ID: %s, RemoteAddr: %s", e.SessionID, e.RemoteAddr)
+		}
+	case EventTransferEnd:
+		Logger.Debugf("FTP Transfer connection closed: ftp.transfer_close. ID: %s, BytesIn: %d, BytesOut: %d, Duration: %s", e.SessionID, e.BytesIn, e.BytesOut, e.Duration)
+	case EventDisconnect:
+		switch e.Message {
+		case "Idle timeout":
+			Logger.Debugf("Idle timeout: ftp.idle_timeout, ID: %s", e.SessionID)
+		case "Read error":
+			Logger.Errorf("Read error: ftp.read_error, ID: %s, Error: %v", e.SessionID, e.Err)
+		default:
+			Logger.Debugf("%s: ftp.disconnect, ID: %s, Clean: %t", e.Message, e.SessionID, e.Err == nil)
+		}
+	}
+}